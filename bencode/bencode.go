@@ -0,0 +1,536 @@
+// Package bencode implements encoding and decoding of the bencode format
+// used by .torrent files and the BitTorrent wire protocol, including
+// reflect-based (de)serialisation of Go structs via `bencode` tags.
+package bencode
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// Bytes is a convenience alias some callers may find more idiomatic than
+// RawMessage; both name the same type.
+type Bytes = RawMessage
+
+// RawMessage holds the exact bencoded bytes of a value instead of decoding
+// it further. Decoding into a RawMessage field captures the original byte
+// range untouched, which matters for things like an info-hash: re-encoding
+// a decoded dict isn't guaranteed to reproduce the original bytes (e.g. a
+// dict with non-canonical integer forms), so hashing must happen on the
+// bytes as they actually appeared in the file.
+type RawMessage []byte
+
+// MarshalBencode returns m unchanged: it is already valid bencode.
+func (m RawMessage) MarshalBencode() ([]byte, error) {
+	return []byte(m), nil
+}
+
+var rawMessageType = reflect.TypeOf(RawMessage(nil))
+
+// typeMismatchError marks a decode failure that happened only because a
+// bencode value's shape didn't match the Go field it was decoded into
+// (e.g. a string where an int was expected). It's kept distinct from
+// malformed-bencode errors so a `ignore_unmarshal_type_error` tag can
+// recover from it without masking real corruption.
+type typeMismatchError struct {
+	target reflect.Type
+}
+
+func (e *typeMismatchError) Error() string {
+	return fmt.Sprintf("bencode: cannot unmarshal into %s", e.target)
+}
+
+// Marshal returns the bencode encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	var buf []byte
+	enc := &encodeState{}
+	b, err := enc.marshal(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, b...)
+	return buf, nil
+}
+
+// Unmarshal parses bencoded data into v, which must be a non-nil pointer.
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("bencode: Unmarshal requires a non-nil pointer, got %T", v)
+	}
+	d := &decodeState{data: data}
+	if err := d.decodeInto(rv.Elem()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// A Decoder reads a stream of bencoded values from an io.Reader.
+type Decoder struct {
+	r io.Reader
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads everything remaining on the underlying reader and unmarshals
+// it into v. Bencode values are self-delimiting, so in principle a streaming
+// decoder could read only as much as one value needs; this one keeps things
+// simple and reads the rest of the stream up front.
+func (dec *Decoder) Decode(v interface{}) error {
+	data, err := io.ReadAll(dec.r)
+	if err != nil {
+		return err
+	}
+	return Unmarshal(data, v)
+}
+
+// An Encoder writes bencoded values to an io.Writer.
+type Encoder struct {
+	w io.Writer
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+func (enc *Encoder) Encode(v interface{}) error {
+	b, err := Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = enc.w.Write(b)
+	return err
+}
+
+// fieldInfo describes one struct field's bencode tag.
+type fieldInfo struct {
+	index                    []int
+	name                     string
+	omitEmpty                bool
+	ignoreUnmarshalTypeError bool
+}
+
+func fieldsOf(t reflect.Type) []fieldInfo {
+	var fields []fieldInfo
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue // unexported
+		}
+		tag := f.Tag.Get("bencode")
+		if tag == "-" {
+			continue
+		}
+		name := f.Name
+		omitEmpty := false
+		ignoreErr := false
+		if tag != "" {
+			parts := splitTag(tag)
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				switch opt {
+				case "omitempty":
+					omitEmpty = true
+				case "ignore_unmarshal_type_error":
+					ignoreErr = true
+				}
+			}
+		}
+		fields = append(fields, fieldInfo{index: f.Index, name: name, omitEmpty: omitEmpty, ignoreUnmarshalTypeError: ignoreErr})
+	}
+	return fields
+}
+
+func splitTag(tag string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(tag); i++ {
+		if tag[i] == ',' {
+			parts = append(parts, tag[start:i])
+			start = i + 1
+		}
+	}
+	parts = append(parts, tag[start:])
+	return parts
+}
+
+// ---- decoding ----
+
+type decodeState struct {
+	data []byte
+	pos  int
+}
+
+func (d *decodeState) decodeString() (string, error) {
+	start := d.pos
+	for d.pos < len(d.data) && d.data[d.pos] != ':' {
+		d.pos++
+	}
+	if d.pos >= len(d.data) {
+		return "", io.ErrUnexpectedEOF
+	}
+	length, err := strconv.Atoi(string(d.data[start:d.pos]))
+	if err != nil {
+		return "", err
+	}
+	d.pos++ // skip ':'
+	if d.pos+length > len(d.data) {
+		return "", io.ErrUnexpectedEOF
+	}
+	s := string(d.data[d.pos : d.pos+length])
+	d.pos += length
+	return s, nil
+}
+
+func (d *decodeState) decodeInteger() (int, error) {
+	d.pos++ // skip 'i'
+	start := d.pos
+	for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+		d.pos++
+	}
+	if d.pos >= len(d.data) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n, err := strconv.Atoi(string(d.data[start:d.pos]))
+	d.pos++ // skip 'e'
+	return n, err
+}
+
+// decodeAny decodes the value at the current position into a generic
+// interface{} (string, int, []interface{} or map[string]interface{}).
+func (d *decodeState) decodeAny() (interface{}, error) {
+	if d.pos >= len(d.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	switch {
+	case d.data[d.pos] == 'i':
+		return d.decodeInteger()
+	case d.data[d.pos] == 'l':
+		d.pos++
+		list := make([]interface{}, 0)
+		for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+			v, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		d.pos++
+		return list, nil
+	case d.data[d.pos] == 'd':
+		d.pos++
+		dict := make(map[string]interface{})
+		for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+			key, err := d.decodeString()
+			if err != nil {
+				return nil, err
+			}
+			value, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			dict[key] = value
+		}
+		d.pos++
+		return dict, nil
+	case d.data[d.pos] >= '0' && d.data[d.pos] <= '9':
+		return d.decodeString()
+	default:
+		return nil, fmt.Errorf("bencode: unsupported type byte %q at offset %d", d.data[d.pos], d.pos)
+	}
+}
+
+// decodeInto decodes the value at the current position into rv, dispatching
+// on the bencode type marker actually present (not on rv's Go type), so a
+// RawMessage field captures exactly the bytes that were there regardless of
+// what they contain.
+func (d *decodeState) decodeInto(rv reflect.Value) error {
+	if rv.Type() == rawMessageType {
+		start := d.pos
+		if _, err := d.decodeAny(); err != nil {
+			return err
+		}
+		raw := make([]byte, d.pos-start)
+		copy(raw, d.data[start:d.pos])
+		rv.Set(reflect.ValueOf(RawMessage(raw)))
+		return nil
+	}
+
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return d.decodeInto(rv.Elem())
+	}
+
+	if d.pos >= len(d.data) {
+		return io.ErrUnexpectedEOF
+	}
+
+	switch d.data[d.pos] {
+	case 'i':
+		n, err := d.decodeInteger()
+		if err != nil {
+			return err
+		}
+		return setInt(rv, n)
+	case 'l':
+		return d.decodeIntoList(rv)
+	case 'd':
+		if rv.Kind() == reflect.Struct {
+			return d.decodeIntoStruct(rv)
+		}
+		return d.decodeIntoMap(rv)
+	default:
+		s, err := d.decodeString()
+		if err != nil {
+			return err
+		}
+		return setString(rv, s)
+	}
+}
+
+func setInt(rv reflect.Value, n int) error {
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		rv.SetInt(int64(n))
+		return nil
+	case reflect.Interface:
+		rv.Set(reflect.ValueOf(n))
+		return nil
+	default:
+		return &typeMismatchError{target: rv.Type()}
+	}
+}
+
+func setString(rv reflect.Value, s string) error {
+	switch {
+	case rv.Kind() == reflect.String:
+		rv.SetString(s)
+		return nil
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+		rv.SetBytes([]byte(s))
+		return nil
+	case rv.Kind() == reflect.Interface:
+		rv.Set(reflect.ValueOf(s))
+		return nil
+	default:
+		return &typeMismatchError{target: rv.Type()}
+	}
+}
+
+func (d *decodeState) decodeIntoList(rv reflect.Value) error {
+	if rv.Kind() == reflect.Interface {
+		v, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if rv.Kind() != reflect.Slice {
+		return &typeMismatchError{target: rv.Type()}
+	}
+	d.pos++ // skip 'l'
+	elemType := rv.Type().Elem()
+	slice := reflect.MakeSlice(rv.Type(), 0, 0)
+	for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+		elem := reflect.New(elemType).Elem()
+		if err := d.decodeInto(elem); err != nil {
+			return err
+		}
+		slice = reflect.Append(slice, elem)
+	}
+	if d.pos >= len(d.data) {
+		return io.ErrUnexpectedEOF
+	}
+	d.pos++ // skip 'e'
+	rv.Set(slice)
+	return nil
+}
+
+func (d *decodeState) decodeIntoMap(rv reflect.Value) error {
+	if rv.Kind() == reflect.Interface {
+		v, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		rv.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return &typeMismatchError{target: rv.Type()}
+	}
+	d.pos++ // skip 'd'
+	m := reflect.MakeMap(rv.Type())
+	elemType := rv.Type().Elem()
+	for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+		key, err := d.decodeString()
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(elemType).Elem()
+		if err := d.decodeInto(elem); err != nil {
+			return err
+		}
+		m.SetMapIndex(reflect.ValueOf(key), elem)
+	}
+	if d.pos >= len(d.data) {
+		return io.ErrUnexpectedEOF
+	}
+	d.pos++ // skip 'e'
+	rv.Set(m)
+	return nil
+}
+
+func (d *decodeState) decodeIntoStruct(rv reflect.Value) error {
+	d.pos++ // skip 'd'
+	fields := fieldsOf(rv.Type())
+	byName := make(map[string]fieldInfo, len(fields))
+	for _, f := range fields {
+		byName[f.name] = f
+	}
+	for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+		key, err := d.decodeString()
+		if err != nil {
+			return err
+		}
+		field, ok := byName[key]
+		if !ok {
+			if _, err := d.decodeAny(); err != nil {
+				return err
+			}
+			continue
+		}
+		fv := rv.FieldByIndex(field.index)
+		if err := d.decodeInto(fv); err != nil {
+			var mismatch *typeMismatchError
+			if field.ignoreUnmarshalTypeError && isTypeMismatch(err, &mismatch) {
+				continue
+			}
+			return err
+		}
+	}
+	if d.pos >= len(d.data) {
+		return io.ErrUnexpectedEOF
+	}
+	d.pos++ // skip 'e'
+	return nil
+}
+
+func isTypeMismatch(err error, target **typeMismatchError) bool {
+	m, ok := err.(*typeMismatchError)
+	if ok {
+		*target = m
+	}
+	return ok
+}
+
+// ---- encoding ----
+
+type encodeState struct{}
+
+func (enc *encodeState) marshal(rv reflect.Value) ([]byte, error) {
+	if !rv.IsValid() {
+		return nil, fmt.Errorf("bencode: cannot marshal invalid value")
+	}
+
+	if rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("bencode: cannot marshal nil %s", rv.Type())
+		}
+		return enc.marshal(rv.Elem())
+	}
+
+	if m, ok := rv.Interface().(interface{ MarshalBencode() ([]byte, error) }); ok {
+		return m.MarshalBencode()
+	}
+
+	switch rv.Kind() {
+	case reflect.String:
+		return []byte(fmt.Sprintf("%d:%s", rv.Len(), rv.String())), nil
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := rv.Bytes()
+			return []byte(fmt.Sprintf("%d:%s", len(b), b)), nil
+		}
+		return enc.marshalList(rv)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return []byte(fmt.Sprintf("i%de", rv.Int())), nil
+	case reflect.Map:
+		return enc.marshalMap(rv)
+	case reflect.Struct:
+		return enc.marshalStruct(rv)
+	default:
+		return nil, fmt.Errorf("bencode: unsupported type %s", rv.Type())
+	}
+}
+
+func (enc *encodeState) marshalList(rv reflect.Value) ([]byte, error) {
+	out := []byte{'l'}
+	for i := 0; i < rv.Len(); i++ {
+		b, err := enc.marshal(rv.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, b...)
+	}
+	return append(out, 'e'), nil
+}
+
+func (enc *encodeState) marshalMap(rv reflect.Value) ([]byte, error) {
+	if rv.Type().Key().Kind() != reflect.String {
+		return nil, fmt.Errorf("bencode: map key must be string, got %s", rv.Type().Key())
+	}
+	keys := rv.MapKeys()
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.String()
+	}
+	sort.Strings(names)
+
+	out := []byte{'d'}
+	for _, name := range names {
+		b, err := enc.marshal(rv.MapIndex(reflect.ValueOf(name)))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, []byte(fmt.Sprintf("%d:%s", len(name), name))...)
+		out = append(out, b...)
+	}
+	return append(out, 'e'), nil
+}
+
+func (enc *encodeState) marshalStruct(rv reflect.Value) ([]byte, error) {
+	type kv struct {
+		name string
+		enc  []byte
+	}
+	var entries []kv
+	for _, f := range fieldsOf(rv.Type()) {
+		fv := rv.FieldByIndex(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		b, err := enc.marshal(fv)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, kv{f.name, b})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+
+	out := []byte{'d'}
+	for _, e := range entries {
+		out = append(out, []byte(fmt.Sprintf("%d:%s", len(e.name), e.name))...)
+		out = append(out, e.enc...)
+	}
+	return append(out, 'e'), nil
+}
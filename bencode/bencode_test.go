@@ -0,0 +1,170 @@
+package bencode
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalPrimitives(t *testing.T) {
+	tests := []struct {
+		in   string
+		want interface{}
+	}{
+		{"i42e", 42},
+		{"i-7e", -7},
+		{"4:spam", "spam"},
+		{"0:", ""},
+		{"l4:spami42ee", []interface{}{"spam", 42}},
+		{"d3:cow3:moo4:spam4:eggse", map[string]interface{}{"cow": "moo", "spam": "eggs"}},
+	}
+	for _, tt := range tests {
+		var got interface{}
+		if err := Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Fatalf("Unmarshal(%q): %v", tt.in, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Unmarshal(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMarshalPrimitives(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want string
+	}{
+		{42, "i42e"},
+		{-7, "i-7e"},
+		{"spam", "4:spam"},
+		{[]interface{}{"spam", 42}, "l4:spami42ee"},
+		{map[string]interface{}{"cow": "moo", "spam": "eggs"}, "d3:cow3:moo4:spam4:eggse"},
+	}
+	for _, tt := range tests {
+		got, err := Marshal(tt.in)
+		if err != nil {
+			t.Fatalf("Marshal(%#v): %v", tt.in, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("Marshal(%#v) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStructTagsRoundTrip(t *testing.T) {
+	type info struct {
+		Name        string `bencode:"name"`
+		PieceLength int    `bencode:"piece length"`
+		Private     int    `bencode:"private,omitempty"`
+	}
+
+	in := info{Name: "file.txt", PieceLength: 16384}
+	encoded, err := Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	// omitempty must drop the zero-value field entirely.
+	if bytes.Contains(encoded, []byte("private")) {
+		t.Errorf("Marshal(%#v) = %q, expected omitempty field to be dropped", in, encoded)
+	}
+
+	var out info
+	if err := Unmarshal(encoded, &out); err != nil {
+		t.Fatalf("Unmarshal(%q): %v", encoded, err)
+	}
+	if out != in {
+		t.Errorf("round trip = %#v, want %#v", out, in)
+	}
+}
+
+func TestUnmarshalIgnoreUnmarshalTypeError(t *testing.T) {
+	type target struct {
+		Loose int    `bencode:"loose,ignore_unmarshal_type_error"`
+		Other string `bencode:"other"`
+	}
+
+	// "loose" is a string in the wire data but an int in the struct: without
+	// the tag this would be a hard error.
+	in := "d5:loose4:oops5:other3:abce"
+	var out target
+	if err := Unmarshal([]byte(in), &out); err != nil {
+		t.Fatalf("Unmarshal with ignore_unmarshal_type_error: %v", err)
+	}
+	if out.Other != "abc" {
+		t.Errorf("Other = %q, want %q", out.Other, "abc")
+	}
+	if out.Loose != 0 {
+		t.Errorf("Loose = %d, want 0 (mismatched field left untouched)", out.Loose)
+	}
+}
+
+func TestUnmarshalWithoutIgnoreTagFails(t *testing.T) {
+	type target struct {
+		Loose int `bencode:"loose"`
+	}
+	var out target
+	if err := Unmarshal([]byte("d5:loose4:oopse"), &out); err == nil {
+		t.Fatal("expected a type-mismatch error without ignore_unmarshal_type_error")
+	}
+}
+
+func TestRawMessagePreservesExactBytes(t *testing.T) {
+	type wrapper struct {
+		Info RawMessage `bencode:"info"`
+	}
+
+	// Non-canonical integer form ("i007e") would not survive a decode-then-
+	// re-encode round trip, so RawMessage must capture the literal bytes.
+	in := "d4:infod6:lengthi007e4:name4:testee"
+	var out wrapper
+	if err := Unmarshal([]byte(in), &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	want := "d6:lengthi007e4:name4:teste"
+	if string(out.Info) != want {
+		t.Errorf("RawMessage = %q, want %q", out.Info, want)
+	}
+}
+
+func TestDecoderEncoderRoundTrip(t *testing.T) {
+	type payload struct {
+		A int    `bencode:"a"`
+		B string `bencode:"b"`
+	}
+	in := payload{A: 1, B: "hi"}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode(in); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	var out payload
+	if err := NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if out != in {
+		t.Errorf("round trip = %#v, want %#v", out, in)
+	}
+}
+
+func TestUnmarshalRequiresNonNilPointer(t *testing.T) {
+	var v interface{}
+	if err := Unmarshal([]byte("i1e"), v); err == nil {
+		t.Fatal("expected error for non-pointer target")
+	}
+	if err := Unmarshal([]byte("i1e"), (*int)(nil)); err == nil {
+		t.Fatal("expected error for nil pointer target")
+	}
+}
+
+func TestUnmarshalTruncatedInputIsError(t *testing.T) {
+	tests := []string{"i42", "4:spa"}
+	for _, in := range tests {
+		var v interface{}
+		if err := Unmarshal([]byte(in), &v); err == nil {
+			t.Errorf("Unmarshal(%q): expected error on truncated input", in)
+		}
+	}
+}
@@ -4,244 +4,178 @@ import (
 	"bytes"
 	"crypto/sha1"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
-	"net/http"
+	"net/url"
 	"os"
-	"sort"
+	"path/filepath"
 	"strconv"
-	"unicode"
-)
-
-var PIECE_BLOCK_MAX_SIZE = 1 << 14
+	"strings"
+	"sync"
 
-func _decodeString(bencodedString string) (string, int, error) {
-	firstColonIndex := 0
+	"github.com/mykhailo-budish/codecrafters-bittorrent-go/bencode"
+	"github.com/mykhailo-budish/codecrafters-bittorrent-go/storage"
+	"github.com/mykhailo-budish/codecrafters-bittorrent-go/tracker"
+)
 
-	for bencodedString[firstColonIndex] != ':' {
-		firstColonIndex++
-	}
+// pieceRequestWindow caps how many block requests a peer connection keeps
+// outstanding at once, so a single round trip isn't wasted waiting for one
+// 16 KiB block before asking for the next.
+const pieceRequestWindow = 5
 
-	lengthStr := bencodedString[:firstColonIndex]
+// streamReadaheadBytes is how far ahead of its read position the "stream"
+// command asks the scheduler to prioritize, so playback doesn't stall
+// waiting on a piece that rarest-first would otherwise fetch last.
+const streamReadaheadBytes = 4 * 1024 * 1024
 
-	length, err := strconv.Atoi(lengthStr)
-	if err != nil {
-		return "", 0, err
-	}
-	partLength := length + firstColonIndex + 1
+var PIECE_BLOCK_MAX_SIZE = 1 << 14
 
-	return bencodedString[firstColonIndex+1 : firstColonIndex+1+length], partLength, nil
+// FileInfo describes one file inside a multi-file torrent's info dict.
+type FileInfo struct {
+	Length int      `bencode:"length"`
+	Path   []string `bencode:"path"`
 }
 
-func _decodeInteger(bencodedNumber string) (int, int, error) {
-	numberEnd := 1
-	for bencodedNumber[numberEnd] != 'e' {
-		numberEnd++
-	}
-	number, err := strconv.Atoi(bencodedNumber[1:numberEnd])
-	if err != nil {
-		return 0, 0, err
-	}
-
-	return number, numberEnd + 1, nil
+// Info is a torrent's info dict, typed instead of juggled as
+// map[string]interface{}. Length is set for single-file torrents, Files for
+// multi-file ones.
+type Info struct {
+	Name        string     `bencode:"name"`
+	PieceLength int        `bencode:"piece length"`
+	Pieces      string     `bencode:"pieces"`
+	Length      int        `bencode:"length,omitempty"`
+	Files       []FileInfo `bencode:"files,omitempty"`
 }
 
-func _decodeList(bencodedList string) ([]interface{}, int, error) {
-	emptyList := make([]interface{}, 0)
-	if bencodedList == "le" {
-		return emptyList, 0, nil
-	}
-	var elements []interface{}
-	lastElementEndIndex := 0
-	for bencodedList[lastElementEndIndex+1] != 'e' {
-		element, elementLength, err := decodeBencodeData(bencodedList[lastElementEndIndex+1:])
-		if err != nil {
-			return emptyList, 0, err
-		}
-		elements = append(elements, element)
-		lastElementEndIndex += elementLength
-	}
-	return elements, lastElementEndIndex + 2, nil
+// MetaInfo is the top-level dict of a .torrent file. InfoBytes keeps the
+// info dict's original bytes (via bencode.RawMessage) so InfoHash can hash
+// exactly what the file contained instead of a re-encoding of it, which
+// would produce the wrong hash for a dict with non-canonical integer forms
+// or non-string keys.
+type MetaInfo struct {
+	Announce     string             `bencode:"announce"`
+	AnnounceList [][]string         `bencode:"announce-list,omitempty"`
+	InfoBytes    bencode.RawMessage `bencode:"info"`
 }
 
-func _decodeDict(bencodedDict string) (map[string]interface{}, int, error) {
-	emptyDict := make(map[string]interface{})
-	if bencodedDict == "de" {
-		return emptyDict, 0, nil
-	}
-	dict := emptyDict
-	lastElementEndIndex := 0
-	for bencodedDict[lastElementEndIndex+1] != 'e' {
-		key, keyLength, err := _decodeString(bencodedDict[lastElementEndIndex+1:])
-		if err != nil {
-			return emptyDict, 0, err
-		}
-		value, valueLength, err := decodeBencodeData(bencodedDict[lastElementEndIndex+keyLength+1:])
-		if err != nil {
-			return emptyDict, 0, err
-		}
-		dict[key] = value
-		lastElementEndIndex += keyLength + valueLength
-	}
-	return dict, lastElementEndIndex + 2, nil
+func (m *MetaInfo) Info() (Info, error) {
+	var info Info
+	err := bencode.Unmarshal(m.InfoBytes, &info)
+	return info, err
 }
 
-func decodeBencodeData(bencodedString string) (interface{}, int, error) {
-	if unicode.IsDigit(rune(bencodedString[0])) {
-		return _decodeString(bencodedString)
-	}
-
-	if bencodedString[0] == 'i' {
-		return _decodeInteger(bencodedString)
-	}
-
-	if bencodedString[0] == 'l' {
-		return _decodeList(bencodedString)
-	}
-
-	if bencodedString[0] == 'd' {
-		return _decodeDict(bencodedString)
-	}
-
-	return "", 0, fmt.Errorf("unsupported type")
+func (m *MetaInfo) InfoHash() [20]byte {
+	return sha1.Sum(m.InfoBytes)
 }
 
-func _encodeString(stringToEncode string) string {
-	strLength := len(stringToEncode)
-	return fmt.Sprintf("%d:%s", strLength, stringToEncode)
-}
-
-func _encodeInteger(numberToEncode int) string {
-	return fmt.Sprintf("i%de", numberToEncode)
+// PieceHashes splits the info dict's pieces blob into its 20-byte SHA-1
+// hashes, one per piece.
+func (info Info) PieceHashes() [][]byte {
+	var hashes [][]byte
+	for i := 0; i+20 <= len(info.Pieces); i += 20 {
+		hashes = append(hashes, []byte(info.Pieces[i:i+20]))
+	}
+	return hashes
 }
 
-func _encodeList(listToEncode []interface{}) string {
-	listString := "l"
-	for _, value := range listToEncode {
-		encodedValue, err := encodeData(value)
-		if err != nil {
-			panic(err)
-		}
-		listString += encodedValue
+// TotalLength is the combined size of the torrent's data: Length for a
+// single-file torrent, or the sum of Files for a multi-file one.
+func (info Info) TotalLength() int64 {
+	if len(info.Files) == 0 {
+		return int64(info.Length)
 	}
-	return listString + "e"
+	var total int64
+	for _, file := range info.Files {
+		total += int64(file.Length)
+	}
+	return total
 }
 
-func _encodeDict(dictToEncode map[string]interface{}) string {
-	dictString := "d"
-	keys := make([]string, 0, len(dictToEncode))
-	for key := range dictToEncode {
-		keys = append(keys, key)
+// FileSpecs maps the info dict onto the on-disk files the scheduler should
+// write to: a single file at outputPath, or one file per Files entry nested
+// under outputPath/Name for a multi-file torrent.
+func (info Info) FileSpecs(outputPath string) []storage.FileSpec {
+	if len(info.Files) == 0 {
+		return []storage.FileSpec{{Path: outputPath, Length: int64(info.Length)}}
 	}
-
-	sort.Strings(keys)
-
-	for _, key := range keys {
-		value, ok := dictToEncode[key]
-		if !ok {
-			panic("Invalid dict")
+	specs := make([]storage.FileSpec, len(info.Files))
+	for i, file := range info.Files {
+		specs[i] = storage.FileSpec{
+			Path:   filepath.Join(append([]string{outputPath, info.Name}, file.Path...)...),
+			Length: int64(file.Length),
 		}
-		dictString += _encodeString(key)
-		encodedValue, err := encodeData(value)
-		if err != nil {
-			panic(err)
-		}
-		dictString += encodedValue
 	}
-	return dictString + "e"
+	return specs
 }
 
-func encodeData(itemToEncode interface{}) (string, error) {
-	switch typedItem := itemToEncode.(type) {
-	case string:
-		return _encodeString(typedItem), nil
-	case int:
-		return _encodeInteger(typedItem), nil
-	case []interface{}:
-		return _encodeList(typedItem), nil
-	case map[string]interface{}:
-		return _encodeDict(typedItem), nil
-	default:
-		return "", fmt.Errorf("unsupported type")
-	}
+// magnetLink holds the pieces of a magnet URI that matter for metadata
+// exchange: the v1 info-hash, any tracker URLs from `tr` params, and the
+// optional display name from `dn`.
+type magnetLink struct {
+	infoHash    [20]byte
+	trackers    []string
+	displayName string
 }
 
-func getDecodedFile(torrentFileName string) map[string]interface{} {
-	fileBytes, err := os.ReadFile(torrentFileName)
+func parseMagnetLink(magnetURI string) (magnetLink, error) {
+	parsed, err := url.Parse(magnetURI)
 	if err != nil {
-		panic(err)
+		return magnetLink{}, err
 	}
-
-	decodedTorrentFile, _, err := _decodeDict(string(fileBytes))
-	if err != nil {
-		panic(err)
+	if parsed.Scheme != "magnet" {
+		return magnetLink{}, fmt.Errorf("not a magnet link: %s", magnetURI)
 	}
-	return decodedTorrentFile
-}
 
-func downloadPiece(decodedTorrentFile map[string]interface{}, pieceIndex int) (piece []byte, pieceLength int) {
-	torrentFileInfo, ok := decodedTorrentFile["info"].(map[string]interface{})
-	if !ok {
-		panic("Invalid torrent file")
+	query := parsed.Query()
+	xt := query.Get("xt")
+	if !strings.HasPrefix(xt, "urn:btih:") {
+		return magnetLink{}, fmt.Errorf("missing or unsupported xt param: %s", xt)
 	}
-
-	fileLength, ok := torrentFileInfo["length"].(int)
-	if !ok {
-		panic("Invalid torrent file")
-	}
-
-	encodedInfo := _encodeDict(torrentFileInfo)
-
-	trackerUrl, ok := decodedTorrentFile["announce"].(string)
-	if !ok {
-		panic("Invalid torrent file")
-	}
-
-	client := &http.Client{}
-	req, err := http.NewRequest(http.MethodGet, trackerUrl, nil)
+	hashHex := strings.TrimPrefix(xt, "urn:btih:")
+	infoHashBytes, err := hex.DecodeString(hashHex)
 	if err != nil {
-		fmt.Println(err)
-		return nil, 0
+		return magnetLink{}, err
+	}
+	if len(infoHashBytes) != 20 {
+		return magnetLink{}, fmt.Errorf("info hash has wrong length: %d", len(infoHashBytes))
 	}
 
-	query := req.URL.Query()
-	query.Add("info_hash", fmt.Sprintf("%s", sha1.Sum([]byte(encodedInfo))))
-	query.Add("peer_id", "05022003050220034586")
-	query.Add("port", "6881")
-	query.Add("uploaded", "0")
-	query.Add("downloaded", "0")
-	query.Add("left", fmt.Sprint(fileLength))
-	query.Add("compact", "1")
+	var link magnetLink
+	copy(link.infoHash[:], infoHashBytes)
+	link.trackers = query["tr"]
+	link.displayName = query.Get("dn")
 
-	req.URL.RawQuery = query.Encode()
+	return link, nil
+}
 
-	response, err := client.Do(req)
+func readMetaInfo(torrentFileName string) MetaInfo {
+	fileBytes, err := os.ReadFile(torrentFileName)
 	if err != nil {
-		fmt.Println(err)
-		return nil, 0
+		panic(err)
 	}
 
-	defer response.Body.Close()
-	responseBody, err := io.ReadAll(response.Body)
-	if err != nil {
-		fmt.Println(err)
-		return nil, 0
+	var metaInfo MetaInfo
+	if err := bencode.Unmarshal(fileBytes, &metaInfo); err != nil {
+		panic(err)
 	}
+	return metaInfo
+}
 
-	decodedBody, _, err := _decodeDict(string(responseBody))
+func downloadPiece(metaInfo MetaInfo, pieceIndex int) (piece []byte, pieceLength int) {
+	info, err := metaInfo.Info()
 	if err != nil {
-		fmt.Println(string(responseBody))
 		panic(err)
 	}
+	infoHash := metaInfo.InfoHash()
 
-	peers, ok := decodedBody["peers"].(string)
-	if !ok {
-		fmt.Println(string(responseBody))
+	peers := getPeers(metaInfo.Announce, metaInfo.AnnounceList, infoHash, int(info.TotalLength()))
+	if len(peers) == 0 {
+		panic("tracker returned no peers")
 	}
-
-	address := fmt.Sprintf("%d.%d.%d.%d:%d", peers[0], peers[1], peers[2], peers[3], int(peers[4])*256+int(peers[5]))
+	address := peers[0]
 
 	fmt.Printf("%s\n", address)
 	conn, err := net.Dial("tcp", address)
@@ -254,7 +188,7 @@ func downloadPiece(decodedTorrentFile map[string]interface{}, pieceIndex int) (p
 	reserved := make([]byte, 8)
 	handshake := append([]byte{pstrlen}, pstr...)
 	handshake = append(handshake, reserved...)
-	handshake = append(handshake, []byte(fmt.Sprintf("%s", sha1.Sum([]byte(encodedInfo))))...)
+	handshake = append(handshake, infoHash[:]...)
 	handshake = append(handshake, []byte("00112233445566778899")...)
 
 	_, err = conn.Write(handshake)
@@ -295,10 +229,11 @@ func downloadPiece(decodedTorrentFile map[string]interface{}, pieceIndex int) (p
 		panic("Received unexpected message, expected unchoke")
 	}
 	fmt.Println("got unchoke")
-	piecesAmount := len(torrentFileInfo["pieces"].(string)) / 20
-	pieceLength = torrentFileInfo["piece length"].(int)
+	pieceHashes := info.PieceHashes()
+	piecesAmount := len(pieceHashes)
+	pieceLength = info.PieceLength
 	if pieceIndex == piecesAmount-1 {
-		pieceLength = fileLength - pieceLength*(piecesAmount-1)
+		pieceLength = int(info.TotalLength()) - pieceLength*(piecesAmount-1)
 	}
 	pieceBlocksAmount := pieceLength / PIECE_BLOCK_MAX_SIZE
 	if pieceLength%PIECE_BLOCK_MAX_SIZE > 0 {
@@ -342,7 +277,6 @@ func downloadPiece(decodedTorrentFile map[string]interface{}, pieceIndex int) (p
 		err = binary.Read(conn, binary.BigEndian, &messageLength)
 		if err != nil {
 			if err.Error() == "EOF" {
-				// i -= PIECE_BLOCK_MAX_SIZE
 				break
 			}
 		}
@@ -366,181 +300,797 @@ func downloadPiece(decodedTorrentFile map[string]interface{}, pieceIndex int) (p
 		}
 	}
 	pieceSumFromPeer := sha1.Sum(piece)
-	pieceHashFromFile := []byte(torrentFileInfo["pieces"].(string)[pieceIndex*20 : (pieceIndex+1)*20])
-	if !bytes.Equal(pieceSumFromPeer[:], pieceHashFromFile) {
+	if !bytes.Equal(pieceSumFromPeer[:], pieceHashes[pieceIndex]) {
 		panic("Invalid piece checksum")
 	}
 	return piece, pieceLength
 }
 
-func main() {
-	command := os.Args[1]
+// getPeers announces to a torrent's trackers (HTTP or UDP, honouring
+// announce-list tiers) and returns the compact peer addresses reported
+// back, panicking if none of them can be reached.
+func getPeers(announce string, announceList [][]string, infoHash [20]byte, left int) []string {
+	peers, err := tracker.GetPeers(announce, announceList, infoHash, left)
+	if err != nil {
+		panic(err)
+	}
+	return peers
+}
 
-	if command == "decode" {
-		bencodedValue := os.Args[2]
+// sendExtendedMessage wraps a bencoded payload in a BitTorrent message with
+// ID 20 (extended) and the given extended message ID, and writes it to conn.
+func sendExtendedMessage(conn net.Conn, extendedId byte, payload []byte) error {
+	lengthBuffer := new(bytes.Buffer)
+	binary.Write(lengthBuffer, binary.BigEndian, uint32(len(payload)+2))
+	message := lengthBuffer.Bytes()
+	message = append(message, 20, extendedId)
+	message = append(message, payload...)
+	_, err := conn.Write(message)
+	return err
+}
 
-		decoded, _, err := decodeBencodeData(bencodedValue)
+// readPeerMessage reads one length-prefixed peer wire message, skipping
+// keep-alives (length 0), and returns its message ID and payload.
+func readPeerMessage(conn net.Conn) (messageId uint8, payload []byte, err error) {
+	var messageLength uint32
+	for {
+		err = binary.Read(conn, binary.BigEndian, &messageLength)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return 0, nil, err
+		}
+		if messageLength > 0 {
+			break
 		}
+	}
 
-		jsonOutput, _ := json.Marshal(decoded)
-		fmt.Println(string(jsonOutput))
-	} else if command == "info" {
-		fileName := os.Args[2]
+	err = binary.Read(conn, binary.BigEndian, &messageId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	payload = make([]byte, messageLength-1)
+	_, err = io.ReadAtLeast(conn, payload, len(payload))
+	if err != nil {
+		return 0, nil, err
+	}
+	return messageId, payload, nil
+}
+
+// extendedHandshake performs the base BitTorrent handshake with the
+// extension-protocol reserved bit (BEP 10, bit 20 of the reserved bytes,
+// i.e. 0x10 at offset 5) set, followed by the extended handshake message
+// (ID 20, extended ID 0) advertising ut_metadata support. It returns the
+// peer's ut_metadata extended message ID and, if the peer knows it, the
+// metadata size.
+func extendedHandshake(conn net.Conn, infoHash [20]byte) (peerMetadataId int, metadataSize int, err error) {
+	pstrlen := byte(19)
+	pstr := []byte("BitTorrent protocol")
+	reserved := make([]byte, 8)
+	reserved[5] |= 0x10
+	handshake := append([]byte{pstrlen}, pstr...)
+	handshake = append(handshake, reserved...)
+	handshake = append(handshake, infoHash[:]...)
+	handshake = append(handshake, []byte("00112233445566778899")...)
+
+	if _, err = conn.Write(handshake); err != nil {
+		return 0, 0, err
+	}
+
+	buf := make([]byte, len(handshake))
+	if _, err = io.ReadAtLeast(conn, buf, len(buf)); err != nil {
+		return 0, 0, err
+	}
+	peerReserved := buf[20:28]
+	if peerReserved[5]&0x10 == 0 {
+		return 0, 0, fmt.Errorf("peer does not support extensions")
+	}
+	fmt.Printf("Peer ID: %x\n", buf[len(buf)-20:])
+
+	handshakePayload, err := bencode.Marshal(map[string]interface{}{
+		"m": map[string]interface{}{
+			"ut_metadata": 1,
+		},
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if err = sendExtendedMessage(conn, 0, handshakePayload); err != nil {
+		return 0, 0, err
+	}
 
-		fileBytes, err := os.ReadFile(fileName)
+	// Peers commonly send a bitfield (or have/choke) message before their
+	// extended handshake reply, so skip anything that isn't an extended
+	// handshake (id 20, extended id 0) rather than failing on the first
+	// non-matching message. Bounded so a peer that never sends one doesn't
+	// hang this goroutine forever.
+	const maxMessagesBeforeExtendedHandshake = 32
+	var messageId uint8
+	var payload []byte
+	for i := 0; ; i++ {
+		if i >= maxMessagesBeforeExtendedHandshake {
+			return 0, 0, fmt.Errorf("peer never sent an extended handshake after %d messages", i)
+		}
+		messageId, payload, err = readPeerMessage(conn)
 		if err != nil {
-			panic(err)
+			return 0, 0, err
+		}
+		if messageId == 20 && len(payload) > 0 && payload[0] == 0 {
+			break
+		}
+	}
+
+	var decoded struct {
+		M struct {
+			UtMetadata int `bencode:"ut_metadata"`
+		} `bencode:"m"`
+		MetadataSize int `bencode:"metadata_size,omitempty"`
+	}
+	if err = bencode.Unmarshal(payload[1:], &decoded); err != nil {
+		return 0, 0, err
+	}
+	if decoded.M.UtMetadata == 0 {
+		return 0, 0, fmt.Errorf("peer does not support ut_metadata")
+	}
+
+	return decoded.M.UtMetadata, decoded.MetadataSize, nil
+}
+
+// fetchMetadata requests the info dict from a peer 16 KiB piece at a time
+// over the ut_metadata extension (BEP 9) and verifies it against infoHash.
+func fetchMetadata(conn net.Conn, peerMetadataId int, metadataSize int, infoHash [20]byte) ([]byte, error) {
+	metadata := make([]byte, 0, metadataSize)
+
+	for piece := 0; len(metadata) < metadataSize; piece++ {
+		requestPayload, err := bencode.Marshal(map[string]interface{}{
+			"msg_type": 0,
+			"piece":    piece,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = sendExtendedMessage(conn, byte(peerMetadataId), requestPayload); err != nil {
+			return nil, err
 		}
 
-		decoded, _, err := _decodeDict(string(fileBytes))
+		messageId, payload, err := readPeerMessage(conn)
 		if err != nil {
-			panic(err)
+			return nil, err
+		}
+		if messageId != 20 || len(payload) == 0 {
+			return nil, fmt.Errorf("expected extended message, got message id %d", messageId)
 		}
 
-		trackerUrl, ok := decoded["announce"].(string)
-		if !ok {
-			panic("Invalid torrent file")
+		var header struct {
+			MsgType int `bencode:"msg_type"`
+		}
+		rawHeader := bencode.RawMessage(nil)
+		if err := bencode.Unmarshal(payload[1:], &rawHeader); err != nil {
+			return nil, err
 		}
-		fmt.Printf("Tracker URL: %s\n", trackerUrl)
-		info, ok := decoded["info"].(map[string]interface{})
-		if !ok {
-			panic("Invalid torrent file")
+		if err := bencode.Unmarshal(rawHeader, &header); err != nil {
+			return nil, err
 		}
-		length, ok := info["length"].(int)
-		if !ok {
-			panic("Invalid torrent file")
+		if header.MsgType != 1 {
+			return nil, fmt.Errorf("unexpected msg_type in metadata reply: %d", header.MsgType)
 		}
-		fmt.Printf("Length: %d\n", length)
 
-		encodedInfo, err := encodeData(info)
-		if err != nil {
-			panic(err)
+		data := payload[1+len(rawHeader):]
+		metadata = append(metadata, data...)
+	}
+
+	metadataHash := sha1.Sum(metadata)
+	if !bytes.Equal(metadataHash[:], infoHash[:]) {
+		return nil, fmt.Errorf("metadata does not match info hash")
+	}
+
+	return metadata, nil
+}
+
+// downloadViaMagnetLink fetches the info dict for a magnet link over the
+// peer wire protocol and assembles a MetaInfo compatible with downloadPiece,
+// so the rest of the download pipeline can be reused as-is.
+func downloadViaMagnetLink(magnetURI string) MetaInfo {
+	link, err := parseMagnetLink(magnetURI)
+	if err != nil {
+		panic(err)
+	}
+	if len(link.trackers) == 0 {
+		panic("magnet link has no trackers")
+	}
+
+	peers := getPeers(link.trackers[0], [][]string{link.trackers}, link.infoHash, 1)
+	if len(peers) == 0 {
+		panic("tracker returned no peers")
+	}
+
+	conn, err := net.Dial("tcp", peers[0])
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+
+	peerMetadataId, metadataSize, err := extendedHandshake(conn, link.infoHash)
+	if err != nil {
+		panic(err)
+	}
+
+	metadata, err := fetchMetadata(conn, peerMetadataId, metadataSize, link.infoHash)
+	if err != nil {
+		panic(err)
+	}
+
+	return MetaInfo{
+		Announce:     link.trackers[0],
+		AnnounceList: [][]string{link.trackers},
+		InfoBytes:    bencode.RawMessage(metadata),
+	}
+}
+
+// piecePriority lets callers (e.g. a future streaming reader) bump specific
+// pieces ahead of the rarest-first ordering.
+type piecePriority int
+
+const (
+	PiecePriorityNone piecePriority = iota
+	PiecePriorityNormal
+	PiecePriorityNext
+	PiecePriorityNow
+)
+
+type pieceState struct {
+	complete     bool
+	requested    bool
+	availability int
+	priority     piecePriority
+}
+
+// Torrent tracks the state of an in-progress download across every peer
+// connection: which pieces are done, how rare each piece is among the
+// peers we've seen a bitfield from, and where the data lives on disk.
+type Torrent struct {
+	metaInfo    MetaInfo
+	infoHash    [20]byte
+	pieceHashes [][]byte
+	pieceLength int
+	fileLength  int64
+	peers       []string
+	storage     storage.Storage
+
+	mu          sync.Mutex
+	cond        *sync.Cond
+	pieces      []pieceState
+	downloadErr error // set and broadcast once Download gives up, so waiters don't block forever
+}
+
+// NewTorrent builds the scheduler state for a .torrent file's info dict,
+// opens (or resumes) its on-disk storage at outputPath, and looks up the
+// peer list from its tracker. Pieces the persisted bitfield already trusts
+// are marked complete without re-hashing; anything else is verified against
+// its on-disk bytes, so a second run against the same outputPath resumes
+// instead of re-downloading everything.
+func NewTorrent(metaInfo MetaInfo, outputPath string) *Torrent {
+	info, err := metaInfo.Info()
+	if err != nil {
+		panic(err)
+	}
+	pieceHashes := info.PieceHashes()
+	infoHash := metaInfo.InfoHash()
+
+	store, err := storage.Open(outputPath, info.FileSpecs(outputPath), len(pieceHashes))
+	if err != nil {
+		panic(err)
+	}
+
+	t := &Torrent{
+		metaInfo:    metaInfo,
+		infoHash:    infoHash,
+		pieceHashes: pieceHashes,
+		pieceLength: info.PieceLength,
+		fileLength:  info.TotalLength(),
+		storage:     store,
+		pieces:      make([]pieceState, len(pieceHashes)),
+	}
+	t.cond = sync.NewCond(&t.mu)
+	for i := range t.pieces {
+		t.pieces[i].priority = PiecePriorityNormal
+		if store.PieceComplete(i) || t.verifyPieceOnDisk(i) {
+			t.pieces[i].complete = true
+			store.MarkPieceComplete(i)
 		}
-		fmt.Printf("Info Hash: %x\n", sha1.Sum([]byte(encodedInfo)))
+	}
+	if !t.allComplete() {
+		t.peers = getPeers(metaInfo.Announce, metaInfo.AnnounceList, infoHash, int(info.TotalLength()))
+	}
+	return t
+}
+
+// verifyPieceOnDisk re-hashes whatever is already on disk for a piece. It's
+// the fallback for pieces the persisted bitfield doesn't already vouch for.
+func (t *Torrent) verifyPieceOnDisk(index int) bool {
+	length := t.pieceLengthFor(index)
+	buf := make([]byte, length)
+	if _, err := t.storage.ReadAt(buf, int64(index)*int64(t.pieceLength)); err != nil {
+		return false
+	}
+	hash := sha1.Sum(buf)
+	return bytes.Equal(hash[:], t.pieceHashes[index])
+}
 
-		pieceLength, ok := info["piece length"].(int)
-		if !ok {
-			panic("Invalid torrent file")
+func (t *Torrent) pieceLengthFor(index int) int {
+	if index == len(t.pieces)-1 {
+		return int(t.fileLength - int64(t.pieceLength)*int64(len(t.pieces)-1))
+	}
+	return t.pieceLength
+}
+
+// registerAvailability records that a connected peer's bitfield has the
+// given piece, for rarest-first selection.
+func (t *Torrent) registerAvailability(bitfield []bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, have := range bitfield {
+		if have && i < len(t.pieces) {
+			t.pieces[i].availability++
 		}
-		fmt.Printf("Piece Length: %d\n", pieceLength)
+	}
+}
 
-		pieces, ok := info["pieces"].(string)
-		if !ok {
-			panic("Invalid torrent file")
+// claimNextPiece picks the next piece to download for a peer advertising
+// the given bitfield: highest priority first, then rarest (lowest
+// availability) among pieces that peer actually has. Returns -1 if there's
+// nothing this peer can help with right now.
+func (t *Torrent) claimNextPiece(bitfield []bool) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	best := -1
+	for i := range t.pieces {
+		p := &t.pieces[i]
+		if p.complete || p.requested {
+			continue
 		}
-		fmt.Println("Piece Hashes:")
-		piecesLength := len(pieces)
-		for i := 0; i < piecesLength; i += 20 {
-			piece := pieces[i : i+20]
-			fmt.Printf("%x\n", piece)
+		if bitfield != nil && (i >= len(bitfield) || !bitfield[i]) {
+			continue
 		}
-	} else if command == "peers" {
-		fileName := os.Args[2]
+		if best == -1 {
+			best = i
+			continue
+		}
+		if p.priority != t.pieces[best].priority {
+			if p.priority > t.pieces[best].priority {
+				best = i
+			}
+			continue
+		}
+		if p.availability < t.pieces[best].availability {
+			best = i
+		}
+	}
+	if best >= 0 {
+		t.pieces[best].requested = true
+	}
+	return best
+}
 
-		fileBytes, err := os.ReadFile(fileName)
-		if err != nil {
-			panic(err)
+// releasePiece puts a piece back up for grabs after a failed download or a
+// hash mismatch, instead of leaving it stuck as requested forever.
+func (t *Torrent) releasePiece(index int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pieces[index].requested = false
+}
+
+func (t *Torrent) completePiece(index int, data []byte) error {
+	if _, err := t.storage.WriteAt(data, int64(index)*int64(t.pieceLength)); err != nil {
+		return err
+	}
+	if err := t.storage.MarkPieceComplete(index); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pieces[index].complete = true
+	t.pieces[index].requested = false
+	t.cond.Broadcast()
+	return nil
+}
+
+func (t *Torrent) allComplete() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.pieces {
+		if !p.complete {
+			return false
 		}
+	}
+	return true
+}
 
-		decoded, _, err := _decodeDict(string(fileBytes))
-		if err != nil {
-			panic(err)
+// waitForPiece blocks until the given piece has finished downloading, for
+// readers that need a piece's bytes before the scheduler would otherwise
+// get around to fetching it. It returns Download's error instead of
+// blocking forever if the download has given up without completing index.
+func (t *Torrent) waitForPiece(index int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for !t.pieces[index].complete {
+		if t.downloadErr != nil {
+			return t.downloadErr
+		}
+		t.cond.Wait()
+	}
+	return nil
+}
+
+// setPriority overrides a piece's scheduling priority, e.g. so a streaming
+// reader's readahead window is fetched ahead of the normal rarest-first
+// order.
+func (t *Torrent) setPriority(index int, priority piecePriority) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pieces[index].priority = priority
+}
+
+// Close releases the torrent's on-disk storage. Callers that keep reading
+// via a TorrentReader after Download returns must call Close themselves
+// once they're done, since Download no longer closes storage on their
+// behalf.
+func (t *Torrent) Close() error {
+	return t.storage.Close()
+}
+
+// TorrentReader is an io.Reader/io.ReaderAt over a torrent's data that
+// blocks on reads until the pieces they cover have finished downloading,
+// so a partially-downloaded torrent can be streamed as it arrives instead
+// of waiting for Download to finish.
+type TorrentReader struct {
+	t         *Torrent
+	pos       int64
+	readahead int64
+}
+
+// NewTorrentReader returns a reader over t starting at offset 0.
+func NewTorrentReader(t *Torrent) *TorrentReader {
+	return &TorrentReader{t: t}
+}
+
+// SetReadahead bumps the priority of the pieces covering the next `bytes`
+// beyond the reader's current position, so the scheduler fetches them
+// ahead of the normal rarest-first order instead of only on demand.
+func (r *TorrentReader) SetReadahead(bytes int64) {
+	r.readahead = bytes
+}
+
+func (r *TorrentReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	return n, err
+}
+
+// ReadAt blocks until every piece overlapping [off, off+len(p)) has
+// finished downloading, then serves the read from disk.
+func (r *TorrentReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.t.fileLength {
+		return 0, io.EOF
+	}
+	if off+int64(len(p)) > r.t.fileLength {
+		p = p[:r.t.fileLength-off]
+	}
+
+	r.bumpReadahead(off)
+
+	firstPiece := int(off / int64(r.t.pieceLength))
+	lastPiece := int((off + int64(len(p)) - 1) / int64(r.t.pieceLength))
+	for i := firstPiece; i <= lastPiece; i++ {
+		if err := r.t.waitForPiece(i); err != nil {
+			return 0, err
 		}
+	}
 
-		info, ok := decoded["info"].(map[string]interface{})
-		if !ok {
-			panic("Invalid torrent file")
+	return r.t.storage.ReadAt(p, off)
+}
+
+// bumpReadahead raises the priority of the pieces from off through the
+// readahead window, highest priority first so the very next piece wins
+// ties against ones further out.
+func (r *TorrentReader) bumpReadahead(off int64) {
+	if r.readahead <= 0 {
+		return
+	}
+	firstPiece := int(off / int64(r.t.pieceLength))
+	lastPiece := int((off + r.readahead) / int64(r.t.pieceLength))
+	for i := firstPiece; i <= lastPiece && i < len(r.t.pieces); i++ {
+		priority := PiecePriorityNext
+		if i == firstPiece {
+			priority = PiecePriorityNow
 		}
+		r.t.setPriority(i, priority)
+	}
+}
+
+// peerConnection is one persistent TCP connection to a peer: the handshake
+// and bitfield/unchoke dance happen once, and every piece that peer is
+// asked for is downloaded over the same socket.
+type peerConnection struct {
+	conn     net.Conn
+	bitfield []bool
+}
+
+// dialPeer performs the handshake, reads the bitfield, declares interest
+// and waits for an unchoke, matching the exchange downloadPiece does
+// per-piece today but doing it once per connection instead.
+func dialPeer(address string, infoHash [20]byte, piecesAmount int) (*peerConnection, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	pstrlen := byte(19)
+	pstr := []byte("BitTorrent protocol")
+	reserved := make([]byte, 8)
+	handshake := append([]byte{pstrlen}, pstr...)
+	handshake = append(handshake, reserved...)
+	handshake = append(handshake, infoHash[:]...)
+	handshake = append(handshake, []byte("00112233445566778899")...)
+
+	if _, err = conn.Write(handshake); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	buf := make([]byte, len(handshake))
+	if _, err = io.ReadAtLeast(conn, buf, len(buf)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	messageId, payload, err := readPeerMessage(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if messageId != 5 {
+		conn.Close()
+		return nil, fmt.Errorf("expected bitfield, got message id %d", messageId)
+	}
+	if len(payload) < (piecesAmount+7)/8 {
+		conn.Close()
+		return nil, fmt.Errorf("bitfield too short for %d pieces: got %d bytes", piecesAmount, len(payload))
+	}
+	bitfield := make([]bool, piecesAmount)
+	for i := 0; i < piecesAmount; i++ {
+		bitfield[i] = payload[i/8]&(1<<(7-uint(i%8))) != 0
+	}
 
-		fileLength, ok := info["length"].(int)
-		if !ok {
-			panic("Invalid torrent file")
+	interestedLength := new(bytes.Buffer)
+	binary.Write(interestedLength, binary.BigEndian, uint32(1))
+	interested := append(interestedLength.Bytes(), 2)
+	if _, err = conn.Write(interested); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	messageId, _, err = readPeerMessage(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if messageId != 1 {
+		conn.Close()
+		return nil, fmt.Errorf("expected unchoke, got message id %d", messageId)
+	}
+
+	return &peerConnection{conn: conn, bitfield: bitfield}, nil
+}
+
+// downloadPieceFromConn fetches one piece over an already-handshaken peer
+// connection, keeping up to pieceRequestWindow block requests outstanding
+// at a time instead of the request/read/request/read pattern downloadPiece
+// uses.
+func downloadPieceFromConn(pc *peerConnection, pieceIndex int, pieceLength int) ([]byte, error) {
+	piece := make([]byte, pieceLength)
+
+	type block struct {
+		begin  int
+		length int
+	}
+	var blocks []block
+	for begin := 0; begin < pieceLength; begin += PIECE_BLOCK_MAX_SIZE {
+		length := PIECE_BLOCK_MAX_SIZE
+		if begin+length > pieceLength {
+			length = pieceLength - begin
 		}
+		blocks = append(blocks, block{begin, length})
+	}
 
-		encodedInfo := _encodeDict(info)
+	sendRequest := func(b block) error {
+		payloadBuffer := new(bytes.Buffer)
+		binary.Write(payloadBuffer, binary.BigEndian, uint32(13))
+		payload := payloadBuffer.Bytes()
+		payload = append(payload, 6)
 
-		trackerUrl, ok := decoded["announce"].(string)
-		if !ok {
-			panic("Invalid torrent file")
+		indexBuffer := new(bytes.Buffer)
+		binary.Write(indexBuffer, binary.BigEndian, uint32(pieceIndex))
+		payload = append(payload, indexBuffer.Bytes()...)
+
+		beginBuffer := new(bytes.Buffer)
+		binary.Write(beginBuffer, binary.BigEndian, uint32(b.begin))
+		payload = append(payload, beginBuffer.Bytes()...)
+
+		lengthBuffer := new(bytes.Buffer)
+		binary.Write(lengthBuffer, binary.BigEndian, uint32(b.length))
+		payload = append(payload, lengthBuffer.Bytes()...)
+
+		_, err := pc.conn.Write(payload)
+		return err
+	}
+
+	inFlight := 0
+	nextToSend := 0
+	received := 0
+	for received < len(blocks) {
+		for inFlight < pieceRequestWindow && nextToSend < len(blocks) {
+			if err := sendRequest(blocks[nextToSend]); err != nil {
+				return nil, err
+			}
+			nextToSend++
+			inFlight++
 		}
 
-		client := &http.Client{}
-		req, err := http.NewRequest(http.MethodGet, trackerUrl, nil)
+		messageId, payload, err := readPeerMessage(pc.conn)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return nil, err
+		}
+		if messageId != 7 {
+			continue
+		}
+		if len(payload) < 8 {
+			return nil, fmt.Errorf("piece message too short: got %d bytes", len(payload))
+		}
+		blockBegin := binary.BigEndian.Uint32(payload[4:8])
+		block := payload[8:]
+		if int64(blockBegin)+int64(len(block)) > int64(len(piece)) {
+			return nil, fmt.Errorf("piece message out of bounds: begin %d, length %d, piece length %d", blockBegin, len(block), len(piece))
 		}
+		copy(piece[blockBegin:], block)
+		inFlight--
+		received++
+	}
 
-		query := req.URL.Query()
-		query.Add("info_hash", fmt.Sprintf("%s", sha1.Sum([]byte(encodedInfo))))
-		query.Add("peer_id", "05022003050220034586")
-		query.Add("port", "6881")
-		query.Add("uploaded", "0")
-		query.Add("downloaded", "0")
-		query.Add("left", fmt.Sprint(fileLength))
-		query.Add("compact", "1")
+	return piece, nil
+}
 
-		req.URL.RawQuery = query.Encode()
+// peerWorker owns one persistent connection and repeatedly asks the
+// scheduler for the next piece it can help with until there's nothing left,
+// downloading each piece with pipelined block requests. Hash failures
+// re-queue the piece instead of aborting the whole download.
+func peerWorker(t *Torrent, address string, infoHash [20]byte, results chan<- struct{}) {
+	pc, err := dialPeer(address, infoHash, len(t.pieces))
+	if err != nil {
+		fmt.Printf("peer %s: %s\n", address, err)
+		return
+	}
+	defer pc.conn.Close()
 
-		response, err := client.Do(req)
-		if err != nil {
-			fmt.Println(err)
+	t.registerAvailability(pc.bitfield)
+
+	for {
+		index := t.claimNextPiece(pc.bitfield)
+		if index == -1 {
 			return
 		}
 
-		defer response.Body.Close()
-		responseBody, err := io.ReadAll(response.Body)
+		pieceLength := t.pieceLengthFor(index)
+		piece, err := downloadPieceFromConn(pc, index, pieceLength)
 		if err != nil {
-			fmt.Println(err)
+			t.releasePiece(index)
 			return
 		}
 
-		decodedBody, _, err := _decodeDict(string(responseBody))
-		if err != nil {
-			fmt.Println(string(responseBody))
-			panic(err)
+		pieceHash := sha1.Sum(piece)
+		if !bytes.Equal(pieceHash[:], t.pieceHashes[index]) {
+			fmt.Printf("peer %s: bad hash for piece %d, re-queueing\n", address, index)
+			t.releasePiece(index)
+			continue
 		}
 
-		peers, ok := decodedBody["peers"].(string)
-		if !ok {
-			fmt.Println(string(responseBody))
+		if err := t.completePiece(index, piece); err != nil {
+			fmt.Printf("peer %s: failed to persist piece %d: %s\n", address, index, err)
+			t.releasePiece(index)
+			return
 		}
+		results <- struct{}{}
+	}
+}
+
+// Download runs the concurrent scheduler: one persistent connection per
+// peer, pieces handed out rarest-first (or by whatever priority a
+// TorrentReader's readahead has set), until every piece is complete or
+// every peer connection has given up. Pieces already verified on disk from
+// a previous run are skipped entirely. Storage stays open when Download
+// returns; call Close once nothing will read from the torrent anymore.
+func (t *Torrent) Download() error {
+	if t.allComplete() {
+		return nil
+	}
+
+	results := make(chan struct{}, len(t.pieces))
+	var wg sync.WaitGroup
+	for _, address := range t.peers {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			peerWorker(t, address, t.infoHash, results)
+		}(address)
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	for range results {
+	}
+
+	if !t.allComplete() {
+		err := fmt.Errorf("download finished without every piece completing")
+		t.mu.Lock()
+		t.downloadErr = err
+		t.cond.Broadcast()
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
 
-		peersLength := len(peers)
-		for i := 0; i < peersLength; i += 6 {
-			ip := peers[i : i+4]
-			port := peers[i+4 : i+6]
+func main() {
+	command := os.Args[1]
+
+	if command == "decode" {
+		bencodedValue := os.Args[2]
 
-			fmt.Printf(
-				"%d.%d.%d.%d:%d\n",
-				ip[0],
-				ip[1],
-				ip[2],
-				ip[3],
-				int(port[0])*256+int(port[1]),
-			)
+		var decoded interface{}
+		if err := bencode.Unmarshal([]byte(bencodedValue), &decoded); err != nil {
+			fmt.Println(err)
+			return
 		}
 
-	} else if command == "handshake" {
+		jsonOutput, _ := json.Marshal(decoded)
+		fmt.Println(string(jsonOutput))
+	} else if command == "info" {
 		fileName := os.Args[2]
-		address := os.Args[3]
-
-		// address := "178.62.85.20:51489"
+		metaInfo := readMetaInfo(fileName)
 
-		fileBytes, err := os.ReadFile(fileName)
+		fmt.Printf("Tracker URL: %s\n", metaInfo.Announce)
+		info, err := metaInfo.Info()
 		if err != nil {
 			panic(err)
 		}
+		fmt.Printf("Length: %d\n", info.TotalLength())
+		fmt.Printf("Info Hash: %x\n", metaInfo.InfoHash())
+		fmt.Printf("Piece Length: %d\n", info.PieceLength)
 
-		decoded, _, err := _decodeDict(string(fileBytes))
+		fmt.Println("Piece Hashes:")
+		for _, hash := range info.PieceHashes() {
+			fmt.Printf("%x\n", hash)
+		}
+	} else if command == "peers" {
+		fileName := os.Args[2]
+		metaInfo := readMetaInfo(fileName)
+
+		info, err := metaInfo.Info()
 		if err != nil {
 			panic(err)
 		}
-		info := decoded["info"].(map[string]interface{})
-		encodedInfo := _encodeDict(info)
+
+		for _, address := range getPeers(metaInfo.Announce, metaInfo.AnnounceList, metaInfo.InfoHash(), int(info.TotalLength())) {
+			fmt.Println(address)
+		}
+	} else if command == "handshake" {
+		fileName := os.Args[2]
+		address := os.Args[3]
+
+		metaInfo := readMetaInfo(fileName)
+		infoHash := metaInfo.InfoHash()
 
 		conn, err := net.Dial("tcp", address)
 		if err != nil {
@@ -551,7 +1101,7 @@ func main() {
 		reserved := make([]byte, 8)
 		handshake := append([]byte{pstrlen}, pstr...)
 		handshake = append(handshake, reserved...)
-		handshake = append(handshake, []byte(fmt.Sprintf("%s", sha1.Sum([]byte(encodedInfo))))...)
+		handshake = append(handshake, infoHash[:]...)
 		handshake = append(handshake, []byte("00112233445566778899")...)
 
 		_, err = conn.Write(handshake)
@@ -579,27 +1129,55 @@ func main() {
 			panic(err)
 		}
 
-		piece, _ := downloadPiece(getDecodedFile(torrentFileName), pieceIndex)
+		piece, _ := downloadPiece(readMetaInfo(torrentFileName), pieceIndex)
 		os.WriteFile(outputFilePath, piece, os.ModePerm)
 		fmt.Printf("Piece %d downloaded to %s.", pieceIndex, outputFilePath)
 	} else if command == "download" {
 		outputFilePath := os.Args[3]
 		torrentFileName := os.Args[4]
-		decodedTorrentFile := getDecodedFile(torrentFileName)
 
-		torrentFileInfo := decodedTorrentFile["info"].(map[string]interface{})
-		fileLength := torrentFileInfo["length"].(int)
+		torrent := NewTorrent(readMetaInfo(torrentFileName), outputFilePath)
+		if err := torrent.Download(); err != nil {
+			panic(err)
+		}
+		torrent.Close()
+		fmt.Printf("Downloaded %s to %s.", torrentFileName, outputFilePath)
+	} else if command == "magnet_download" {
+		if os.Args[2] != "-o" {
+			panic("Output file is not provided")
+		}
+		outputFilePath := os.Args[3]
+		magnetURI := os.Args[4]
+
+		torrent := NewTorrent(downloadViaMagnetLink(magnetURI), outputFilePath)
+		if err := torrent.Download(); err != nil {
+			panic(err)
+		}
+		torrent.Close()
+		fmt.Printf("Downloaded %s to %s.", magnetURI, outputFilePath)
+	} else if command == "stream" {
+		if os.Args[2] != "-o" {
+			panic("Output file is not provided")
+		}
+		outputFilePath := os.Args[3]
+		torrentFileName := os.Args[4]
+
+		torrent := NewTorrent(readMetaInfo(torrentFileName), outputFilePath)
+		defer torrent.Close()
 
-		piecesAmount := len(torrentFileInfo["pieces"].(string)) / 20
-		wholePieceLength := torrentFileInfo["piece length"].(int)
+		downloadErr := make(chan error, 1)
+		go func() {
+			downloadErr <- torrent.Download()
+		}()
 
-		fileBytes := make([]byte, fileLength)
-		for i := 0; i < piecesAmount; i++ {
-			piece, pieceLength := downloadPiece(decodedTorrentFile, i)
-			copy(fileBytes[i*wholePieceLength:i*wholePieceLength+pieceLength], piece)
+		reader := NewTorrentReader(torrent)
+		reader.SetReadahead(streamReadaheadBytes)
+		if _, err := io.Copy(os.Stdout, reader); err != nil {
+			panic(err)
+		}
+		if err := <-downloadErr; err != nil {
+			panic(err)
 		}
-		os.WriteFile(outputFilePath, fileBytes, os.ModePerm)
-		fmt.Printf("Downloaded %s to %s.", torrentFileName, outputFilePath)
 	} else {
 		fmt.Println("Unknown command: " + command)
 		os.Exit(1)
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"bytes"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestReadWriteSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(filepath.Join(dir, "out"), []FileSpec{{Path: filepath.Join(dir, "out"), Length: 16}}, 2)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	want := []byte("0123456789abcdef")
+	if _, err := s.WriteAt(want, 0); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+
+	got := make([]byte, len(want))
+	if _, err := s.ReadAt(got, 0); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("ReadAt = %q, want %q", got, want)
+	}
+}
+
+func TestReadWriteAcrossMultipleFiles(t *testing.T) {
+	dir := t.TempDir()
+	specs := []FileSpec{
+		{Path: filepath.Join(dir, "a"), Length: 4},
+		{Path: filepath.Join(dir, "b"), Length: 4},
+		{Path: filepath.Join(dir, "c"), Length: 4},
+	}
+	s, err := Open(filepath.Join(dir, "out"), specs, 1)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	// This write spans all three files: 2 bytes into "a", all of "b", 2
+	// bytes into "c".
+	want := []byte("23456789")
+	if _, err := s.WriteAt(want, 2); err != nil {
+		t.Fatalf("WriteAt: %v", err)
+	}
+
+	got := make([]byte, len(want))
+	if _, err := s.ReadAt(got, 2); err != nil {
+		t.Fatalf("ReadAt: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("ReadAt = %q, want %q", got, want)
+	}
+}
+
+func TestReadAtOutOfBounds(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(filepath.Join(dir, "out"), []FileSpec{{Path: filepath.Join(dir, "out"), Length: 8}}, 1)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	buf := make([]byte, 4)
+	if _, err := s.ReadAt(buf, 6); err == nil {
+		t.Error("expected an error reading past the end of storage")
+	}
+}
+
+func TestMarkPieceCompleteRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out")
+	s, err := Open(path, []FileSpec{{Path: path, Length: 8}}, 10)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	for _, index := range []int{0, 3, 9} {
+		if s.PieceComplete(index) {
+			t.Fatalf("piece %d reported complete before being marked", index)
+		}
+		if err := s.MarkPieceComplete(index); err != nil {
+			t.Fatalf("MarkPieceComplete(%d): %v", index, err)
+		}
+		if !s.PieceComplete(index) {
+			t.Fatalf("piece %d not reported complete after being marked", index)
+		}
+	}
+	// Unrelated pieces must stay unaffected.
+	if s.PieceComplete(1) {
+		t.Error("piece 1 reported complete but was never marked")
+	}
+	s.Close()
+
+	// A fresh Open over the same path must load the persisted bitfield.
+	s2, err := Open(path, []FileSpec{{Path: path, Length: 8}}, 10)
+	if err != nil {
+		t.Fatalf("re-Open: %v", err)
+	}
+	defer s2.Close()
+	for _, index := range []int{0, 3, 9} {
+		if !s2.PieceComplete(index) {
+			t.Errorf("piece %d not resumed as complete after reopening", index)
+		}
+	}
+}
+
+func TestMarkPieceCompleteConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out")
+	const pieceCount = 64
+	s, err := Open(path, []FileSpec{{Path: path, Length: pieceCount}}, pieceCount)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < pieceCount; i++ {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			if err := s.MarkPieceComplete(index); err != nil {
+				t.Errorf("MarkPieceComplete(%d): %v", index, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < pieceCount; i++ {
+		if !s.PieceComplete(i) {
+			t.Errorf("piece %d not marked complete after concurrent writes", i)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// Package tracker announces to BitTorrent trackers and parses the compact
+// peer list they reply with. It supports both HTTP(S) trackers and UDP
+// trackers (BEP 15), and understands the announce-list tiers from BEP 12.
+package tracker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mykhailo-budish/codecrafters-bittorrent-go/bencode"
+)
+
+const peerID = "05022003050220034586"
+const clientPort = 6881
+
+// udpConnectMagic is the fixed connection ID a UDP tracker client sends on
+// its first connect request, per BEP 15.
+const udpConnectMagic = 0x41727101980
+
+// udpMaxAttempts caps the connect/announce retransmit loop; BEP 15 specifies
+// a 15·2^n second timeout per attempt, up to 8 attempts.
+const udpMaxAttempts = 8
+
+// GetPeers announces to a torrent's trackers and returns the compact peer
+// addresses reported back. If announceList is non-empty its tiers (BEP 12)
+// are tried in order, each tier's trackers shuffled and tried until one
+// replies with peers; announce is used as a single fallback tier otherwise.
+func GetPeers(announce string, announceList [][]string, infoHash [20]byte, left int) ([]string, error) {
+	tiers := announceList
+	if len(tiers) == 0 {
+		tiers = [][]string{{announce}}
+	}
+
+	var lastErr error
+	for _, tier := range tiers {
+		shuffled := append([]string(nil), tier...)
+		rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+
+		for _, trackerUrl := range shuffled {
+			peers, err := announceOne(trackerUrl, infoHash, left)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			if len(peers) > 0 {
+				return peers, nil
+			}
+		}
+	}
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("tracker: no trackers available")
+}
+
+func announceOne(trackerUrl string, infoHash [20]byte, left int) ([]string, error) {
+	parsed, err := url.Parse(trackerUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parsed.Scheme {
+	case "http", "https":
+		return announceHTTP(trackerUrl, infoHash, left)
+	case "udp":
+		return announceUDP(parsed.Host, infoHash, left)
+	default:
+		return nil, fmt.Errorf("tracker: unsupported scheme %q", parsed.Scheme)
+	}
+}
+
+func announceHTTP(trackerUrl string, infoHash [20]byte, left int) ([]string, error) {
+	client := &http.Client{}
+	req, err := http.NewRequest(http.MethodGet, trackerUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	query := req.URL.Query()
+	query.Add("info_hash", string(infoHash[:]))
+	query.Add("peer_id", peerID)
+	query.Add("port", fmt.Sprint(clientPort))
+	query.Add("uploaded", "0")
+	query.Add("downloaded", "0")
+	query.Add("left", fmt.Sprint(left))
+	query.Add("compact", "1")
+	req.URL.RawQuery = query.Encode()
+
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var trackerResponse struct {
+		Peers string `bencode:"peers"`
+	}
+	if err := bencode.Unmarshal(responseBody, &trackerResponse); err != nil {
+		return nil, fmt.Errorf("tracker: %w (body: %s)", err, responseBody)
+	}
+
+	return parseCompactPeers(trackerResponse.Peers), nil
+}
+
+func parseCompactPeers(peers string) []string {
+	var addresses []string
+	for i := 0; i+6 <= len(peers); i += 6 {
+		ip := peers[i : i+4]
+		port := peers[i+4 : i+6]
+		addresses = append(addresses, fmt.Sprintf("%d.%d.%d.%d:%d", ip[0], ip[1], ip[2], ip[3], int(port[0])*256+int(port[1])))
+	}
+	return addresses
+}
+
+func announceUDP(host string, infoHash [20]byte, left int) ([]string, error) {
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	connectionId, err := udpConnect(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return udpAnnounce(conn, connectionId, infoHash, left)
+}
+
+// udpConnect sends the BEP 15 connect request and returns the connection ID
+// the tracker assigns, retrying with a 15·2^n second timeout up to
+// udpMaxAttempts times.
+func udpConnect(conn net.Conn) (uint64, error) {
+	transactionId := rand.Uint32()
+
+	request := new(bytes.Buffer)
+	binary.Write(request, binary.BigEndian, uint64(udpConnectMagic))
+	binary.Write(request, binary.BigEndian, uint32(0)) // action: connect
+	binary.Write(request, binary.BigEndian, transactionId)
+
+	response := make([]byte, 16)
+	n, err := udpRoundTrip(conn, request.Bytes(), response)
+	if err != nil {
+		return 0, err
+	}
+	if n < 16 {
+		return 0, fmt.Errorf("tracker: short connect response (%d bytes)", n)
+	}
+
+	action := binary.BigEndian.Uint32(response[0:4])
+	gotTransactionId := binary.BigEndian.Uint32(response[4:8])
+	if action != 0 || gotTransactionId != transactionId {
+		return 0, fmt.Errorf("tracker: unexpected connect response")
+	}
+	return binary.BigEndian.Uint64(response[8:16]), nil
+}
+
+func udpAnnounce(conn net.Conn, connectionId uint64, infoHash [20]byte, left int) ([]string, error) {
+	transactionId := rand.Uint32()
+
+	request := new(bytes.Buffer)
+	binary.Write(request, binary.BigEndian, connectionId)
+	binary.Write(request, binary.BigEndian, uint32(1)) // action: announce
+	binary.Write(request, binary.BigEndian, transactionId)
+	request.Write(infoHash[:])
+	request.Write([]byte(peerID))
+	binary.Write(request, binary.BigEndian, uint64(0))          // downloaded
+	binary.Write(request, binary.BigEndian, uint64(left))       // left
+	binary.Write(request, binary.BigEndian, uint64(0))          // uploaded
+	binary.Write(request, binary.BigEndian, uint32(0))          // event: none
+	binary.Write(request, binary.BigEndian, uint32(0))          // IP: default
+	binary.Write(request, binary.BigEndian, rand.Uint32())      // key
+	binary.Write(request, binary.BigEndian, int32(-1))          // num_want: default
+	binary.Write(request, binary.BigEndian, uint16(clientPort)) // port
+
+	response := make([]byte, 20+6*74) // header + room for a generous peer list
+	n, err := udpRoundTrip(conn, request.Bytes(), response)
+	if err != nil {
+		return nil, err
+	}
+	if n < 20 {
+		return nil, fmt.Errorf("tracker: short announce response (%d bytes)", n)
+	}
+
+	action := binary.BigEndian.Uint32(response[0:4])
+	gotTransactionId := binary.BigEndian.Uint32(response[4:8])
+	if action != 1 || gotTransactionId != transactionId {
+		return nil, fmt.Errorf("tracker: unexpected announce response")
+	}
+
+	peers := string(response[20:n])
+	return parseCompactPeers(peers), nil
+}
+
+// udpBackoff returns the BEP 15 retransmit timeout for the given attempt
+// number (0-indexed): 15·2^attempt seconds.
+func udpBackoff(attempt int) time.Duration {
+	return time.Duration(15*(1<<uint(attempt))) * time.Second
+}
+
+// udpRoundTrip sends request and waits for a reply into response, retrying
+// with the BEP 15 backoff (udpBackoff) until one arrives or udpMaxAttempts
+// is exceeded.
+func udpRoundTrip(conn net.Conn, request []byte, response []byte) (int, error) {
+	var lastErr error
+	for attempt := 0; attempt < udpMaxAttempts; attempt++ {
+		if _, err := conn.Write(request); err != nil {
+			return 0, err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(udpBackoff(attempt)))
+		n, err := conn.Read(response)
+		conn.SetReadDeadline(time.Time{})
+		if err == nil {
+			return n, nil
+		}
+		lastErr = err
+	}
+	return 0, fmt.Errorf("tracker: udp request timed out after %d attempts: %w", udpMaxAttempts, lastErr)
+}
@@ -0,0 +1,104 @@
+package tracker
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseCompactPeers(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []string
+	}{
+		{
+			name: "single peer",
+			in:   string([]byte{192, 168, 1, 1, 0x1A, 0xE1}), // port 6881
+			want: []string{"192.168.1.1:6881"},
+		},
+		{
+			name: "multiple peers",
+			in:   string([]byte{1, 2, 3, 4, 0, 80, 5, 6, 7, 8, 0x1F, 0x90}),
+			want: []string{"1.2.3.4:80", "5.6.7.8:8080"},
+		},
+		{
+			name: "empty",
+			in:   "",
+			want: nil,
+		},
+		{
+			name: "trailing partial entry is ignored",
+			in:   string([]byte{1, 2, 3, 4, 0, 80, 9, 9}),
+			want: []string{"1.2.3.4:80"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseCompactPeers(tt.in)
+			if len(got) != len(tt.want) {
+				t.Fatalf("parseCompactPeers(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("parseCompactPeers(%q)[%d] = %q, want %q", tt.in, i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestUdpBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 15 * time.Second},
+		{1, 30 * time.Second},
+		{2, 60 * time.Second},
+		{3, 120 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := udpBackoff(tt.attempt); got != tt.want {
+			t.Errorf("udpBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestUdpRoundTripSucceedsOnFirstAttempt(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	reply := []byte{1, 2, 3, 4}
+	go func() {
+		buf := make([]byte, len(reply))
+		if _, err := server.Read(buf); err != nil {
+			return
+		}
+		server.Write(reply)
+	}()
+
+	response := make([]byte, len(reply))
+	n, err := udpRoundTrip(client, reply, response)
+	if err != nil {
+		t.Fatalf("udpRoundTrip: %v", err)
+	}
+	if n != len(reply) {
+		t.Errorf("udpRoundTrip returned %d bytes, want %d", n, len(reply))
+	}
+}
+
+func TestUdpRoundTripReturnsWriteErrorImmediately(t *testing.T) {
+	client, server := net.Pipe()
+	server.Close() // any write on client now fails without waiting on a deadline
+
+	start := time.Now()
+	_, err := udpRoundTrip(client, []byte{1}, make([]byte, 1))
+	if err == nil {
+		t.Fatal("expected an error from a closed connection")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("udpRoundTrip took %v, expected to fail immediately on write error", elapsed)
+	}
+}